@@ -2,11 +2,14 @@ package wkhtmltopdf
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sync"
 )
 
 // A Document represents a single pdf document.
@@ -15,7 +18,21 @@ type Document struct {
 	pages   []*Page
 	options []string
 
+	// TempDir overrides the package-level TempDir for this document, so
+	// that a multi-tenant server can sandbox each document's temp files
+	// under a directory of its own.
+	TempDir string
+
 	tmp string // temp directory
+
+	useNamedPipes bool
+	pipeResult    *pipeResult
+
+	httpClient           *http.Client
+	maxConcurrentFetches int
+	urlSpecs             map[*Page]*urlSpec
+
+	postProcessors []PostProcessor
 }
 
 // NewDocument creates a new document.
@@ -26,15 +43,41 @@ func NewDocument(opts ...Option) *Document {
 	return doc
 }
 
+// PageSource is anything that can be added to a Document as a page: a
+// plain *Page, or a Page created via NewPageFromURL, which still needs
+// its own fetch spec carried alongside it.
+type PageSource interface {
+	page() *Page
+}
+
+// page makes *Page itself a PageSource, so existing callers passing
+// *Page to AddPages/AddCover keep working unchanged.
+func (pg *Page) page() *Page {
+	return pg
+}
+
 // AddPages to the document. Pages will be included in
 // the final pdf in the order they are added.
-func (doc *Document) AddPages(pages ...*Page) {
-	doc.pages = append(doc.pages, pages...)
+func (doc *Document) AddPages(srcs ...PageSource) {
+	for _, src := range srcs {
+		pg := src.page()
+		doc.pages = append(doc.pages, pg)
+		doc.registerPageSource(pg, src)
+	}
 }
 
 // AddCover adds a cover page to the document.
-func (doc *Document) AddCover(cover *Page) {
-	doc.cover = cover
+func (doc *Document) AddCover(src PageSource) {
+	pg := src.page()
+	doc.cover = pg
+	doc.registerPageSource(pg, src)
+}
+
+// docOption is implemented by Options that toggle document-level behavior
+// rather than (or in addition to) emitting wkhtmltopdf command-line flags,
+// e.g. UseNamedPipes.
+type docOption interface {
+	apply(doc *Document)
 }
 
 // AddOptions allows the setting of options after document creation.
@@ -42,6 +85,9 @@ func (doc *Document) AddOptions(opts ...Option) {
 
 	for _, opt := range opts {
 		doc.options = append(doc.options, opt.opts()...)
+		if o, ok := opt.(docOption); ok {
+			o.apply(doc)
+		}
 	}
 }
 
@@ -66,6 +112,15 @@ func (doc *Document) args() []string {
 	return args
 }
 
+// tempDirRoot returns the directory new temp directories are created
+// under: doc.TempDir if set, otherwise the package-level TempDir.
+func (doc *Document) tempDirRoot() string {
+	if doc.TempDir != "" {
+		return doc.TempDir
+	}
+	return TempDir
+}
+
 // readers counts the number of pages using a reader
 // as a source
 func (doc *Document) readers() int {
@@ -88,9 +143,9 @@ func (doc *Document) readers() int {
 func (doc *Document) writeTempPages() error {
 
 	var err error
-	doc.tmp, err = ioutil.TempDir(TempDir, "temp")
+	doc.tmp, err = os.MkdirTemp(doc.tempDirRoot(), "temp")
 	if err != nil {
-		return fmt.Errorf("Error creating temp directory")
+		return fmt.Errorf("Error creating temp directory: %v", err)
 	}
 
 	n := 0
@@ -105,8 +160,8 @@ func (doc *Document) writeTempPages() error {
 		}
 
 		n++
-		pg.filename = fmt.Sprintf("%v/%v/page%08d.html", TempDir, doc.tmp, n)
-		err := ioutil.WriteFile(pg.filename, pg.buf.Bytes(), 0666)
+		pg.filename = filepath.Join(doc.tmp, fmt.Sprintf("page%08d.html", n))
+		err := os.WriteFile(pg.filename, pg.buf.Bytes(), 0666)
 		if err != nil {
 			return fmt.Errorf("Error writing temp file: %v", err)
 		}
@@ -116,8 +171,48 @@ func (doc *Document) writeTempPages() error {
 }
 
 // createPDF creates the pdf and writes it to the buffer,
-// which can then be written to file or writer.
+// which can then be written to file or writer. It delegates
+// to createPDFContext with a background context.
 func (doc *Document) createPDF() (*bytes.Buffer, error) {
+	return doc.createPDFContext(context.Background())
+}
+
+// createPDFContext is the context-aware version of createPDF. Running
+// wkhtmltopdf via exec.CommandContext lets callers cancel or time out a
+// hanging invocation, and the temp directory used for reader-backed pages
+// is always removed once the command returns, whether it finished, failed,
+// or was killed because ctx was done.
+func (doc *Document) createPDFContext(ctx context.Context) (buf *bytes.Buffer, err error) {
+
+	if err := doc.prefetchURLPages(ctx); err != nil {
+		return nil, fmt.Errorf("Error prefetching pages: %v", err)
+	}
+
+	// cancelPipes, if set, unblocks any pipe-writer goroutine still
+	// waiting for wkhtmltopdf to open its FIFO. It must run before
+	// doc.pipeResult.wg.Wait() below on every return path, including one
+	// where wkhtmltopdf exited on an earlier page without ever opening
+	// every FIFO, or where ctx was cancelled - otherwise Wait would block
+	// forever on a FIFO nothing will ever open.
+	var cancelPipes context.CancelFunc
+	defer func() {
+		if cancelPipes != nil {
+			cancelPipes()
+		}
+		if doc.pipeResult != nil {
+			doc.pipeResult.wg.Wait()
+			// A page that failed to stream into its FIFO means
+			// wkhtmltopdf may have produced a truncated pdf even
+			// though it exited cleanly; surface that over a clean run.
+			if doc.pipeResult.err != nil && err == nil {
+				buf, err = nil, fmt.Errorf("Error streaming page to wkhtmltopdf: %v", doc.pipeResult.err)
+			}
+		}
+		if doc.tmp != "" {
+			// doc.tmp is already the full path returned by os.MkdirTemp.
+			os.RemoveAll(doc.tmp)
+		}
+	}()
 
 	var stdin io.Reader
 	switch {
@@ -134,8 +229,16 @@ func (doc *Document) createPDF() (*bytes.Buffer, error) {
 
 	case doc.readers() > 1:
 
-		// Write multiple readers to temp files
-		err := doc.writeTempPages()
+		// Write multiple readers to temp files, or stream them through
+		// named pipes if the document was created with UseNamedPipes().
+		var err error
+		if doc.useNamedPipes {
+			var pipeCtx context.Context
+			pipeCtx, cancelPipes = context.WithCancel(ctx)
+			err = doc.writeTempPagesPipes(pipeCtx)
+		} else {
+			err = doc.writeTempPages()
+		}
 		if err != nil {
 			return nil, fmt.Errorf("Error writing temp files: %v", err)
 		}
@@ -143,36 +246,44 @@ func (doc *Document) createPDF() (*bytes.Buffer, error) {
 
 	args := append(doc.args(), "-")
 
-	buf := &bytes.Buffer{}
+	buf = &bytes.Buffer{}
 	errbuf := &bytes.Buffer{}
 
-	cmd := exec.Command(Executable, args...)
+	cmd := exec.CommandContext(ctx, Executable, args...)
 	cmd.Stdin = stdin
 	cmd.Stdout = buf
 	cmd.Stderr = errbuf
 
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("Error running wkhtmltopdf: %v", ctx.Err())
+		}
 		return nil, fmt.Errorf("Error running wkhtmltopdf: %v", errbuf.String())
 	}
 
-	if doc.tmp != "" {
-		err = os.RemoveAll(TempDir + "/" + doc.tmp)
-	}
+	buf, err = doc.runPostProcessors(buf)
 	return buf, err
-
 }
 
 // WriteToFile creates the pdf document and writes it
-// to the specified filename.
+// to the specified filename. It delegates to WriteToFileContext
+// with a background context.
 func (doc *Document) WriteToFile(filename string) error {
+	return doc.WriteToFileContext(context.Background(), filename)
+}
+
+// WriteToFileContext creates the pdf document and writes it to the
+// specified filename, aborting the underlying wkhtmltopdf process if
+// ctx is done before it completes.
+func (doc *Document) WriteToFileContext(ctx context.Context, filename string) error {
 
-	buf, err := doc.createPDF()
+	buf, err := doc.createPDFContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(filename, buf.Bytes(), 0666)
+	err = os.WriteFile(filename, buf.Bytes(), 0666)
 	if err != nil {
 		return fmt.Errorf("Error creating file: %v", err)
 	}
@@ -181,10 +292,18 @@ func (doc *Document) WriteToFile(filename string) error {
 }
 
 // Write creates the pdf document and writes it
-// to the provided reader.
+// to the provided writer. It delegates to WriteContext
+// with a background context.
 func (doc *Document) Write(w io.Writer) error {
+	return doc.WriteContext(context.Background(), w)
+}
+
+// WriteContext creates the pdf document and writes it to the provided
+// writer, aborting the underlying wkhtmltopdf process if ctx is done
+// before it completes.
+func (doc *Document) WriteContext(ctx context.Context, w io.Writer) error {
 
-	buf, err := doc.createPDF()
+	buf, err := doc.createPDFContext(ctx)
 	if err != nil {
 		return err
 	}
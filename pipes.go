@@ -0,0 +1,50 @@
+package wkhtmltopdf
+
+import "sync"
+
+// pipeResult tracks completion of the per-page pipe-writer goroutines
+// spawned by writeTempPagesPipes, including the first error any of them
+// hit streaming a page into its FIFO, so a truncated pipe write isn't
+// silently swallowed behind a clean wkhtmltopdf exit.
+type pipeResult struct {
+	wg  sync.WaitGroup
+	mu  sync.Mutex
+	err error
+}
+
+// fail records err as the pipeResult's error if one hasn't already been
+// recorded. Safe to call concurrently from multiple writer goroutines.
+func (r *pipeResult) fail(err error) {
+	if err == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+}
+
+// namedPipesOption switches a Document from writing reader-backed pages
+// to temp files over to streaming them through named pipes. It carries no
+// wkhtmltopdf command-line flags of its own; it only toggles Document
+// behavior, via docOption.
+type namedPipesOption struct{}
+
+func (namedPipesOption) opts() []string {
+	return nil
+}
+
+func (namedPipesOption) apply(doc *Document) {
+	doc.useNamedPipes = true
+}
+
+// UseNamedPipes makes a Document stream reader-backed pages to
+// wkhtmltopdf through Unix named pipes (syscall.Mkfifo) instead of
+// writing them to temp files first. This avoids materialising page
+// content on disk for large inputs or high-throughput services. On
+// Windows, which has no equivalent wkhtmltopdf can open by path, the
+// document transparently falls back to the existing temp-file behavior.
+func UseNamedPipes() Option {
+	return namedPipesOption{}
+}
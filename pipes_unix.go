@@ -0,0 +1,96 @@
+//go:build !windows
+
+package wkhtmltopdf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// fifoPollInterval is how often openFifoForWrite retries a non-blocking
+// open while waiting for wkhtmltopdf to open the other end.
+const fifoPollInterval = 10 * time.Millisecond
+
+// openFifoForWrite opens fifo for writing without blocking the goroutine
+// indefinitely: a plain O_WRONLY open blocks in the kernel until a reader
+// opens the other end, which never happens if wkhtmltopdf exited on an
+// earlier page or was killed because ctx is done. Polling with
+// O_NONBLOCK lets this loop give up as soon as ctx says to.
+func openFifoForWrite(ctx context.Context, fifo string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(fifo, os.O_WRONLY|os.O_NONBLOCK, 0)
+		if err == nil {
+			return f, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(fifoPollInterval):
+		}
+	}
+}
+
+// writeTempPagesPipes streams reader-backed pages to wkhtmltopdf through
+// named pipes instead of materialising them on disk. One FIFO is created
+// per reader-backed page under a fresh temp directory; a goroutine per
+// page opens its FIFO for writing and copies the page's content into it,
+// while the main goroutine runs wkhtmltopdf, which opens the FIFOs for
+// reading in the order they appear in args() (i.e. the order pages were
+// added to the document), so the writer goroutines never need to
+// coordinate with each other. ctx is cancelled by the caller once
+// wkhtmltopdf has returned, so a writer still waiting on a FIFO nothing
+// will ever open gives up instead of hanging forever.
+func (doc *Document) writeTempPagesPipes(ctx context.Context) error {
+
+	var err error
+	doc.tmp, err = os.MkdirTemp(doc.tempDirRoot(), "temp")
+	if err != nil {
+		return fmt.Errorf("Error creating temp directory: %v", err)
+	}
+
+	all_pages := []*Page{}
+	if doc.cover != nil {
+		all_pages = append(all_pages, doc.cover)
+	}
+	all_pages = append(all_pages, doc.pages...)
+
+	result := &pipeResult{}
+	n := 0
+	for _, pg := range all_pages {
+		if !pg.reader {
+			continue
+		}
+
+		n++
+		fifo := filepath.Join(doc.tmp, fmt.Sprintf("page%08d.html", n))
+		if err := syscall.Mkfifo(fifo, 0600); err != nil {
+			return fmt.Errorf("Error creating named pipe: %v", err)
+		}
+		pg.filename = fifo
+
+		result.wg.Add(1)
+		go func(pg *Page, fifo string) {
+			defer result.wg.Done()
+
+			f, err := openFifoForWrite(ctx, fifo)
+			if err != nil {
+				result.fail(fmt.Errorf("Error opening named pipe: %v", err))
+				return
+			}
+			defer f.Close()
+
+			if _, err := io.Copy(f, pg.buf); err != nil {
+				result.fail(fmt.Errorf("Error streaming page into named pipe: %v", err))
+			}
+		}(pg, fifo)
+	}
+
+	doc.pipeResult = result
+	return nil
+}
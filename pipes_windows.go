@@ -0,0 +1,12 @@
+//go:build windows
+
+package wkhtmltopdf
+
+import "context"
+
+// writeTempPagesPipes falls back to the existing temp-file behavior on
+// Windows, which has no equivalent to Unix named pipes that wkhtmltopdf
+// can open by path.
+func (doc *Document) writeTempPagesPipes(ctx context.Context) error {
+	return doc.writeTempPages()
+}
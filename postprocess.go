@@ -0,0 +1,119 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// A PostProcessor transforms the pdf produced by createPDF before it is
+// written to file or writer. Processors run in the order they were added,
+// each one receiving the buffer returned by the previous one.
+type PostProcessor func(buf *bytes.Buffer) (*bytes.Buffer, error)
+
+// AddPostProcessors registers one or more PostProcessors to run, in order,
+// on the pdf produced by wkhtmltopdf before it is handed back to the
+// caller. They let callers chain pdfcpu operations in memory instead of
+// shelling out to a second tool.
+func (doc *Document) AddPostProcessors(procs ...PostProcessor) {
+	doc.postProcessors = append(doc.postProcessors, procs...)
+}
+
+// runPostProcessors pipes buf through every registered PostProcessor.
+func (doc *Document) runPostProcessors(buf *bytes.Buffer) (*bytes.Buffer, error) {
+
+	for _, proc := range doc.postProcessors {
+		var err error
+		buf, err = proc(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// ValidatePDF returns a PostProcessor that validates the pdf against conf
+// (e.g. model.NewDefaultConfiguration for PDF 1.7, or a configuration with
+// ValidationMode set for PDF 2.0) and returns pdfcpu's structured
+// validation error unchanged, rather than flattening it to a string. The
+// buffer itself passes through untouched.
+func ValidatePDF(conf *model.Configuration) PostProcessor {
+	return func(buf *bytes.Buffer) (*bytes.Buffer, error) {
+		if err := api.Validate(bytes.NewReader(buf.Bytes()), conf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+}
+
+// EncryptPDF returns a PostProcessor that encrypts the pdf with the given
+// owner and user passwords and permission flags.
+func EncryptPDF(ownerPW, userPW string, perm model.PermissionFlags) PostProcessor {
+	return func(buf *bytes.Buffer) (*bytes.Buffer, error) {
+
+		conf := model.NewDefaultConfiguration()
+		conf.OwnerPW = ownerPW
+		conf.UserPW = userPW
+		conf.Permissions = perm
+
+		out := &bytes.Buffer{}
+		if err := api.Encrypt(bytes.NewReader(buf.Bytes()), out, conf); err != nil {
+			return nil, fmt.Errorf("Error encrypting pdf: %v", err)
+		}
+		return out, nil
+	}
+}
+
+// MergeWith returns a PostProcessor that merges the generated pdf, in
+// first position, with one or more externally supplied pdf readers. This
+// is useful when a wkhtmltopdf page must be combined with a separately
+// produced, machine-generated form.
+func MergeWith(others ...io.Reader) PostProcessor {
+	return func(buf *bytes.Buffer) (*bytes.Buffer, error) {
+
+		readers := make([]io.ReadSeeker, 0, len(others)+1)
+		readers = append(readers, bytes.NewReader(buf.Bytes()))
+		for _, r := range others {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading merge source: %v", err)
+			}
+			readers = append(readers, bytes.NewReader(b))
+		}
+
+		out := &bytes.Buffer{}
+		if err := api.MergeRaw(readers, out, false, model.NewDefaultConfiguration()); err != nil {
+			return nil, fmt.Errorf("Error merging pdf: %v", err)
+		}
+		return out, nil
+	}
+}
+
+// StampWatermark returns a PostProcessor that stamps wm onto every page
+// of the generated pdf.
+func StampWatermark(wm *model.Watermark) PostProcessor {
+	return func(buf *bytes.Buffer) (*bytes.Buffer, error) {
+
+		out := &bytes.Buffer{}
+		if err := api.AddWatermarks(bytes.NewReader(buf.Bytes()), out, nil, wm, model.NewDefaultConfiguration()); err != nil {
+			return nil, fmt.Errorf("Error stamping pdf: %v", err)
+		}
+		return out, nil
+	}
+}
+
+// AttachFiles returns a PostProcessor that adds files as attachments to
+// the generated pdf.
+func AttachFiles(files ...string) PostProcessor {
+	return func(buf *bytes.Buffer) (*bytes.Buffer, error) {
+
+		out := &bytes.Buffer{}
+		if err := api.AddAttachments(bytes.NewReader(buf.Bytes()), out, files, model.NewDefaultConfiguration()); err != nil {
+			return nil, fmt.Errorf("Error attaching files to pdf: %v", err)
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,237 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultMaxConcurrentFetches is used when a Document has not been given
+// a MaxConcurrentFetches Option.
+const defaultMaxConcurrentFetches = 4
+
+// urlSpec records the fetch parameters for a Page created with
+// NewPageFromURL.
+type urlSpec struct {
+	url     string
+	header  http.Header
+	timeout time.Duration
+}
+
+// urlPage is the PageSource returned by NewPageFromURL. It carries its
+// own urlSpec instead of registering it in a package-global map, so the
+// spec's lifetime is tied to the Page the caller holds (and, once added,
+// to the Document it was added to) rather than leaking for the life of
+// the process if the page is discarded without ever being rendered.
+type urlPage struct {
+	pg   *Page
+	spec *urlSpec
+}
+
+func (u *urlPage) page() *Page {
+	return u.pg
+}
+
+// PageOption configures a Page created via NewPageFromURL.
+type PageOption func(spec *urlSpec)
+
+// WithHeader sets a header, such as an Authorization header, to send
+// when fetching a NewPageFromURL page.
+func WithHeader(key, value string) PageOption {
+	return func(spec *urlSpec) {
+		spec.header.Set(key, value)
+	}
+}
+
+// WithFetchTimeout bounds how long a single NewPageFromURL page may take
+// to fetch, so one slow remote fragment can't stall a whole document's
+// prefetch up to the document-level ctx deadline.
+func WithFetchTimeout(d time.Duration) PageOption {
+	return func(spec *urlSpec) {
+		spec.timeout = d
+	}
+}
+
+// NewPageFromURL creates a Page whose content is fetched from url. The
+// fetch itself is deferred to Document.createPDF, which prefetches every
+// URL-backed page in the document concurrently (see MaxConcurrentFetches
+// and WithHTTPClient) before handing their buffered content to
+// wkhtmltopdf through the ordinary reader path. Pass the result to
+// AddPages or AddCover like any other page.
+func NewPageFromURL(url string, opts ...PageOption) PageSource {
+
+	spec := &urlSpec{url: url, header: http.Header{}}
+	for _, opt := range opts {
+		opt(spec)
+	}
+
+	pg := &Page{reader: true, buf: &bytes.Buffer{}}
+	return &urlPage{pg: pg, spec: spec}
+}
+
+// httpClientOption and maxConcurrentFetchesOption are docOptions: they
+// carry no wkhtmltopdf command-line flags of their own and only
+// configure how Document.prefetchURLPages behaves.
+
+type httpClientOption struct{ client *http.Client }
+
+func (httpClientOption) opts() []string { return nil }
+
+func (o httpClientOption) apply(doc *Document) { doc.httpClient = o.client }
+
+// WithHTTPClient sets the http.Client used to fetch NewPageFromURL
+// pages, e.g. to configure TLS settings or a shared connection pool.
+func WithHTTPClient(client *http.Client) Option {
+	return httpClientOption{client: client}
+}
+
+type maxConcurrentFetchesOption struct{ n int }
+
+func (maxConcurrentFetchesOption) opts() []string { return nil }
+
+func (o maxConcurrentFetchesOption) apply(doc *Document) { doc.maxConcurrentFetches = o.n }
+
+// MaxConcurrentFetches caps the number of NewPageFromURL pages a
+// Document fetches at once. Without it, a Document prefetches up to
+// defaultMaxConcurrentFetches pages concurrently.
+func MaxConcurrentFetches(n int) Option {
+	return maxConcurrentFetchesOption{n: n}
+}
+
+// registerPageSource records src's urlSpec against pg on doc, if src is a
+// NewPageFromURL page. The spec then lives as long as doc does, so a
+// Document can be rendered (Write/WriteToFile) more than once and still
+// refetch its URL-backed pages each time.
+func (doc *Document) registerPageSource(pg *Page, src PageSource) {
+
+	up, ok := src.(*urlPage)
+	if !ok {
+		return
+	}
+
+	if doc.urlSpecs == nil {
+		doc.urlSpecs = map[*Page]*urlSpec{}
+	}
+	doc.urlSpecs[pg] = up.spec
+}
+
+// urlBackedPages returns the cover and pages of doc that were created
+// with NewPageFromURL, in document order.
+func (doc *Document) urlBackedPages() []*Page {
+
+	all_pages := []*Page{}
+	if doc.cover != nil {
+		all_pages = append(all_pages, doc.cover)
+	}
+	all_pages = append(all_pages, doc.pages...)
+
+	pages := []*Page{}
+	for _, pg := range all_pages {
+		if _, ok := doc.urlSpecs[pg]; ok {
+			pages = append(pages, pg)
+		}
+	}
+	return pages
+}
+
+// prefetchURLPages (re)fetches every NewPageFromURL page in doc
+// concurrently, up to doc.maxConcurrentFetches at a time, buffering each
+// page's body into pg.buf. ctx aborts all in-flight fetches when it is
+// done. Specs stay on doc (see registerPageSource), so calling this
+// again - e.g. via a second Write - refetches every URL-backed page
+// rather than silently reusing stale or drained content.
+func (doc *Document) prefetchURLPages(ctx context.Context) error {
+
+	pages := doc.urlBackedPages()
+	if len(pages) == 0 {
+		return nil
+	}
+
+	client := doc.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	limit := doc.maxConcurrentFetches
+	if limit <= 0 {
+		limit = defaultMaxConcurrentFetches
+	}
+
+	sem := make(chan struct{}, limit)
+	errs := make(chan error, len(pages))
+	wg := &sync.WaitGroup{}
+
+	for _, pg := range pages {
+		spec := doc.urlSpecs[pg]
+		pg.buf.Reset()
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(pg *Page, spec *urlSpec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			errs <- fetchURLPage(ctx, client, pg, spec)
+		}(pg, spec)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchURLPage fetches spec.url and writes its (possibly gzip-encoded)
+// body into pg.buf. If spec.timeout is set, it bounds this fetch alone
+// rather than the document-level ctx.
+func fetchURLPage(ctx context.Context, client *http.Client, pg *Page, spec *urlSpec) error {
+
+	if spec.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, spec.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spec.url, nil)
+	if err != nil {
+		return fmt.Errorf("Error building request for %v: %v", spec.url, err)
+	}
+	req.Header = spec.header
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error fetching %v: %v", spec.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error fetching %v: status %v", spec.url, resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("Error decoding gzip response from %v: %v", spec.url, err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if _, err := io.Copy(pg.buf, body); err != nil {
+		return fmt.Errorf("Error reading response from %v: %v", spec.url, err)
+	}
+
+	return nil
+}